@@ -111,6 +111,15 @@ func newRouter(sc *services.Control, conf cfg.Config) (*web.Router, error) {
 				c.err = err
 			}
 		}).
+		Get("/health", func(c *Context, resp web.ResponseWriter, r *web.Request) {
+			ctx, cancelFn := context.WithTimeout(r.Context(), cfg.RequestTimeout)
+			defer cancelFn()
+			if err := sc.HealthCheck(ctx, connections); err != nil {
+				WriteErr(resp, 503, "unhealthy")
+				return
+			}
+			WriteJSON(resp, []byte(`{"healthy":true}`))
+		}).
 		NotFound((*Context).notFoundHandler).
 		Middleware(func(c *Context, w web.ResponseWriter, r *web.Request, next web.NextMiddlewareFunc) {
 			c.avaxReader = avaxReader
@@ -55,6 +55,35 @@ type DB struct {
 	RODSN  string `json:"rodsn"`
 	Driver string `json:"driver"`
 	TXDB   bool   `json:"txDB"`
+
+	// Timeouts are duration strings such as "5s".  A bare number is read as
+	// nanoseconds, so values below 1ms are rejected when connecting.  Postgres
+	// takes the connect timeout in whole seconds and has no read or write
+	// timeouts.
+	ConnectTimeout time.Duration `json:"connectTimeout"`
+	ReadTimeout    time.Duration `json:"readTimeout"`
+	WriteTimeout   time.Duration `json:"writeTimeout"`
+
+	// MaxExecutionTime is set as the session max_execution_time on every
+	// connection so the server kills runaway statements, and caps the timeout
+	// set by NewSession.  It is read as integer milliseconds, or as a
+	// duration string such as "30s".
+	MaxExecutionTime time.Duration `json:"maxExecutionTime"`
+
+	// Pool tunes read-write connection pools, ROPool read-only ones
+	Pool   DBPool `json:"pool"`
+	ROPool DBPool `json:"roPool"`
+
+	// PoolMetricsInterval is how often pool stats are published as gauges,
+	// as a duration string such as "15s".  Zero disables pool metrics.
+	PoolMetricsInterval time.Duration `json:"poolMetricsInterval"`
+}
+
+// DBPool tunes a database connection pool.  Zero values use the defaults.
+type DBPool struct {
+	MaxIdleConns    int           `json:"maxIdleConns"`
+	ConnMaxIdleTime time.Duration `json:"connMaxIdleTime"`
+	ConnMaxLifetime time.Duration `json:"connMaxLifetime"`
 }
 
 type Redis struct {
@@ -100,6 +129,8 @@ func NewFromFile(filePath string) (*Config, error) {
 	// Get sub vipers for all objects with parents
 	servicesViper := newSubViper(v, keysServices)
 	servicesDBViper := newSubViper(servicesViper, keysServicesDB)
+	servicesDBPoolViper := newSubViper(servicesDBViper, keysServicesDBPool)
+	servicesDBROPoolViper := newSubViper(servicesDBViper, keysServicesDBROPool)
 	servicesRedisViper := newSubViper(servicesViper, keysServicesRedis)
 
 	streamViper := newSubViper(v, keysStream)
@@ -142,6 +173,17 @@ func NewFromFile(filePath string) (*Config, error) {
 				DSN:    dbdsn,
 				RODSN:  dbrodsn,
 				TXDB:   servicesDBViper.GetBool(keysServicesDBTXDB),
+
+				ConnectTimeout: servicesDBViper.GetDuration(keysServicesDBConnectTimeout),
+				ReadTimeout:    servicesDBViper.GetDuration(keysServicesDBReadTimeout),
+				WriteTimeout:   servicesDBViper.GetDuration(keysServicesDBWriteTimeout),
+
+				MaxExecutionTime: getMillisDuration(servicesDBViper, keysServicesDBMaxExecutionTime),
+
+				Pool:   newDBPoolConfig(servicesDBPoolViper),
+				ROPool: newDBPoolConfig(servicesDBROPoolViper),
+
+				PoolMetricsInterval: servicesDBViper.GetDuration(keysServicesDBPoolMetricsInterval),
 			},
 			Redis: &Redis{
 				Addr:     servicesRedisViper.GetString(keysServicesRedisAddr),
@@ -6,6 +6,8 @@ package cfg
 import (
 	"bytes"
 	"log"
+	"strconv"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -91,3 +93,25 @@ func newChainsConfig(v *viper.Viper) (Chains, error) {
 	}
 	return chains, nil
 }
+
+func newDBPoolConfig(v *viper.Viper) DBPool {
+	return DBPool{
+		MaxIdleConns:    v.GetInt(keysServicesDBPoolMaxIdleConns),
+		ConnMaxIdleTime: v.GetDuration(keysServicesDBPoolConnMaxIdleTime),
+		ConnMaxLifetime: v.GetDuration(keysServicesDBPoolConnMaxLifetime),
+	}
+}
+
+// getMillisDuration reads key as a duration string such as "5s", or as
+// integer milliseconds when it is a bare number
+func getMillisDuration(v *viper.Viper, key string) time.Duration {
+	switch val := v.Get(key).(type) {
+	case int, int64, float64:
+		return time.Duration(v.GetInt64(key)) * time.Millisecond
+	case string:
+		if ms, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return v.GetDuration(key)
+}
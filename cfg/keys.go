@@ -24,6 +24,20 @@ const (
 	keysServicesDBRODSN  = "ro_dsn"
 	keysServicesDBTXDB   = "txDB"
 
+	keysServicesDBConnectTimeout = "connectTimeout"
+	keysServicesDBReadTimeout    = "readTimeout"
+	keysServicesDBWriteTimeout   = "writeTimeout"
+
+	keysServicesDBMaxExecutionTime = "maxExecutionTime"
+
+	keysServicesDBPool                = "pool"
+	keysServicesDBROPool              = "roPool"
+	keysServicesDBPoolMaxIdleConns    = "maxIdleConns"
+	keysServicesDBPoolConnMaxIdleTime = "connMaxIdleTime"
+	keysServicesDBPoolConnMaxLifetime = "connMaxLifetime"
+
+	keysServicesDBPoolMetricsInterval = "poolMetricsInterval"
+
 	keysServicesRedis         = "redis"
 	keysServicesRedisAddr     = "addr"
 	keysServicesRedisPassword = "password"
@@ -14,6 +14,7 @@ import (
 	"syscall"
 
 	"github.com/ava-labs/ortelius/services"
+	"github.com/ava-labs/ortelius/services/metrics"
 
 	"github.com/gorilla/rpc/v2"
 	"github.com/gorilla/rpc/v2/json2"
@@ -105,6 +106,7 @@ func execute() error {
 				if config.MetricsListenAddr != "" {
 					sm := http.NewServeMux()
 					sm.Handle("/metrics", promhttp.Handler())
+					sm.Handle("/metrics/openmetrics", metrics.OpenMetricsHandler())
 					go func() {
 						err = http.ListenAndServe(config.MetricsListenAddr, sm)
 						if err != nil {
@@ -6,7 +6,6 @@ import (
 	"log"
 	"net"
 	"sort"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -301,37 +300,25 @@ func (replay *replay) workerProcessor() func(int, interface{}) {
 			var consumererr error
 			switch value.consumeType {
 			case CONSUME:
-				for {
-					consumererr = value.writer.Consume(context.Background(), value.message, replay.persist)
-					if consumererr == nil || !strings.Contains(consumererr.Error(), db.DeadlockDBErrorMessage) {
-						break
-					}
-					time.Sleep(500 * time.Millisecond)
-				}
+				consumererr = db.RetryOnDeadlock(context.Background(), 0, db.DeadlockRetryDelay, func() error {
+					return value.writer.Consume(context.Background(), value.message, replay.persist)
+				})
 				if consumererr != nil {
 					replay.errs.SetValue(consumererr)
 					return
 				}
 			case CONSUMECONSENSUS:
-				for {
-					consumererr = value.writer.ConsumeConsensus(context.Background(), value.message, replay.persist)
-					if consumererr == nil || !strings.Contains(consumererr.Error(), db.DeadlockDBErrorMessage) {
-						break
-					}
-					time.Sleep(500 * time.Millisecond)
-				}
+				consumererr = db.RetryOnDeadlock(context.Background(), 0, db.DeadlockRetryDelay, func() error {
+					return value.writer.ConsumeConsensus(context.Background(), value.message, replay.persist)
+				})
 				if consumererr != nil {
 					replay.errs.SetValue(consumererr)
 					return
 				}
 			case CONSUMEC:
-				for {
-					consumererr = value.cwriter.Consume(context.Background(), value.message, &value.block.Header, replay.persist)
-					if consumererr == nil || !strings.Contains(consumererr.Error(), db.DeadlockDBErrorMessage) {
-						break
-					}
-					time.Sleep(500 * time.Millisecond)
-				}
+				consumererr = db.RetryOnDeadlock(context.Background(), 0, db.DeadlockRetryDelay, func() error {
+					return value.cwriter.Consume(context.Background(), value.message, &value.block.Header, replay.persist)
+				})
 				if consumererr != nil {
 					replay.errs.SetValue(consumererr)
 					return
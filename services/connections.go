@@ -24,6 +24,8 @@ type Connections struct {
 	db    *db.Conn
 	redis *redis.Client
 	cache *cache.Cache
+
+	stopPoolMetrics context.CancelFunc
 }
 
 func NewConnectionsFromConfig(conf cfg.Services, ro bool) (*Connections, error) {
@@ -95,7 +97,27 @@ func (c Connections) DB() *db.Conn           { return c.db }
 func (c Connections) Redis() *redis.Client   { return c.redis }
 func (c Connections) Cache() *cache.Cache    { return c.cache }
 
+// HealthCheck pings the database and, when configured, redis, within the
+// ctx deadline.  Connections holds no stream consumer to verify: its
+// health.Stream only records instrumentation events.
+func (c Connections) HealthCheck(ctx context.Context) error {
+	if c.db != nil {
+		if err := c.db.Ping(ctx); err != nil {
+			return err
+		}
+	}
+	if c.redis != nil {
+		if err := c.redis.Ping(ctx).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c Connections) Close() error {
+	if c.stopPoolMetrics != nil {
+		c.stopPoolMetrics()
+	}
 	errs := wrappers.Errs{}
 	errs.Add(c.db.Close(context.Background()))
 	if c.redis != nil {
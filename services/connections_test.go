@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ava-labs/avalanchego/utils/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/ava-labs/ortelius/cfg"
+	"github.com/ava-labs/ortelius/services/db"
+)
+
+func newClosedConnections(t *testing.T) *Connections {
+	rawDBConn, err := sql.Open(db.DriverMysql, "a:b@tcp(1.2.3.4)/foo")
+	if err != nil {
+		t.Fatal("open failed", err)
+	}
+	if err = rawDBConn.Close(); err != nil {
+		t.Fatal("close failed", err)
+	}
+
+	stream := NewStream()
+	dbConn, err := db.NewFromSQL(stream, rawDBConn, db.DriverMysql)
+	if err != nil {
+		t.Fatal("db conn failed", err)
+	}
+	return NewConnections(stream, dbConn, nil)
+}
+
+func TestHealthCheckClosedDB(t *testing.T) {
+	conns := newClosedConnections(t)
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFn()
+
+	if err := conns.HealthCheck(ctx); err == nil {
+		t.Fatal("Expected health check on a closed db to fail")
+	}
+
+	sc := &Control{Log: logging.NoLog{}}
+	if err := sc.HealthCheck(ctx, conns); err == nil {
+		t.Fatal("Expected control health check on a closed db to fail")
+	}
+}
+
+// stubDriver hands out connections that cannot run statements, enough to
+// drive the pool stats without a database
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return stubConn{}, nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (stubConn) Close() error                        { return nil }
+func (stubConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("services_stub", stubDriver{})
+}
+
+// metricType returns the type of the named metric family
+func metricType(t *testing.T, name string) dto.MetricType {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal("gather failed", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetType()
+		}
+	}
+	t.Fatal("metric not found", name)
+	return 0
+}
+
+// gaugeValue returns the named gauge's value, or -1 before it is registered
+func gaugeValue(t *testing.T, name string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal("gather failed", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return -1
+}
+
+func TestPoolMetrics(t *testing.T) {
+	rawDBConn, err := sql.Open("services_stub", "")
+	if err != nil {
+		t.Fatal("open failed", err)
+	}
+	defer rawDBConn.Close()
+
+	stream := NewStream()
+	dbConn, err := db.NewFromSQL(stream, rawDBConn, db.DriverMysql)
+	if err != nil {
+		t.Fatal("db conn failed", err)
+	}
+	conns := NewConnections(stream, dbConn, nil)
+
+	// Hold a connection so the pool reports one open and in use
+	heldConn, err := rawDBConn.Conn(context.Background())
+	if err != nil {
+		t.Fatal("conn failed", err)
+	}
+	defer heldConn.Close()
+
+	sc := &Control{
+		Services: cfg.Services{DB: &cfg.DB{PoolMetricsInterval: time.Millisecond}},
+		Log:      logging.NoLog{},
+	}
+	ctx, cancelFn := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sc.runPoolMetrics(ctx, "test", conns)
+		close(done)
+	}()
+
+	keyOpen := "test_" + MetricPoolOpenConnectionsKey
+	keyInUse := "test_" + MetricPoolInUseKey
+	deadline := time.Now().Add(5 * time.Second)
+	for gaugeValue(t, keyOpen) != 1 || gaugeValue(t, keyInUse) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("pool stats were not published")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancelFn()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pool metrics did not stop on context cancel")
+	}
+	if gaugeValue(t, keyOpen) != 0 || gaugeValue(t, keyInUse) != 0 {
+		t.Fatal("expected the stopped pool to be removed from the gauges")
+	}
+	if metricType(t, "test_"+MetricPoolWaitCountKey) != dto.MetricType_COUNTER {
+		t.Fatal("expected the pool wait count to be a counter")
+	}
+}
+
+func TestPoolMetricsNegativeInterval(t *testing.T) {
+	sc := &Control{
+		Services: cfg.Services{DB: &cfg.DB{PoolMetricsInterval: -time.Second}},
+		Log:      logging.NoLog{},
+	}
+	conns := newClosedConnections(t)
+	sc.startConnectionsPoolMetrics("test_negative", conns)
+	if conns.stopPoolMetrics != nil {
+		t.Fatal("expected a negative interval to disable pool metrics")
+	}
+}
@@ -6,11 +6,9 @@ package db
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"time"
 
 	"github.com/gocraft/dbr/v2"
-	"github.com/gocraft/dbr/v2/dialect"
 	"github.com/gocraft/health"
 
 	"github.com/ava-labs/ortelius/cfg"
@@ -18,25 +16,59 @@ import (
 
 const (
 	DriverMysql = "mysql"
-	DriverNone  = ""
-	driverTXDB  = "txdb"
+
+	// DriverPostgres supports the db layer only: connections, dialect,
+	// timeouts and error classification.  The migrations and the indexer's
+	// insert-then-update writes are MySQL-only, since Postgres aborts the
+	// transaction on the ignored duplicate insert.
+	DriverPostgres = "postgres"
+	DriverNone     = ""
+	driverTXDB     = "txdb"
 )
 
 // Conn is a wrapper around a dbr connection and a health stream
 type Conn struct {
-	stream *health.Stream
-	conn   *dbr.Connection
+	stream  *health.Stream
+	conn    *dbr.Connection
+	dialect Dialect
+
+	// maxExecutionTime caps the statement timeout set by NewSession
+	maxExecutionTime time.Duration
 }
 
 // New creates a new DB for the given config
 func New(stream *health.Stream, conf cfg.DB, ro bool) (*Conn, error) {
-	conn, err := newDBRConnection(stream, conf, ro)
+	d, err := NewDialect(conf.Driver)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := newDBRConnection(stream, conf, d, ro)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{
+		conn:    conn,
+		stream:  stream,
+		dialect: d,
+
+		maxExecutionTime: conf.MaxExecutionTime,
+	}, nil
+}
+
+// NewFromSQL wraps an already opened database handle for the given driver
+func NewFromSQL(stream *health.Stream, rawDBConn *sql.DB, driver string) (*Conn, error) {
+	d, err := NewDialect(driver)
 	if err != nil {
 		return nil, err
 	}
 	return &Conn{
-		conn:   conn,
-		stream: stream,
+		conn: &dbr.Connection{
+			DB:            rawDBConn,
+			EventReceiver: stream,
+			Dialect:       d.DBR(),
+		},
+		stream:  stream,
+		dialect: d,
 	}, nil
 }
 
@@ -45,18 +77,40 @@ func (c *Conn) Close(context.Context) error {
 	return c.conn.Close()
 }
 
+// Ping verifies the database is reachable within the context deadline
+func (c *Conn) Ping(ctx context.Context) error {
+	return c.conn.PingContext(ctx)
+}
+
+// NewSession returns a session after setting the statement timeout.  The SET
+// SESSION runs on whichever pooled connection serves it and stays on that
+// connection after it is returned to the pool, so the timeout is capped at the
+// configured MaxExecutionTime to keep that limit on every connection.
 func (c *Conn) NewSession(name string, timeout time.Duration) (*dbr.Session, error) {
 	session := c.NewSessionForEventReceiver(c.stream.NewJob(name))
-	if _, err := session.Exec(fmt.Sprintf("SET SESSION MAX_EXECUTION_TIME=%d", timeout.Milliseconds())); err != nil {
+	if _, err := session.Exec(c.dialect.SessionTimeout(sessionTimeout(timeout, c.maxExecutionTime))); err != nil {
 		return nil, err
 	}
 	return session, nil
 }
 
+// sessionTimeout returns timeout capped at maxExecutionTime when it is set.
+// A zero timeout means no limit, so it is capped too.
+func sessionTimeout(timeout time.Duration, maxExecutionTime time.Duration) time.Duration {
+	if maxExecutionTime > 0 && (timeout <= 0 || timeout > maxExecutionTime) {
+		return maxExecutionTime
+	}
+	return timeout
+}
+
 func (c *Conn) NewSessionForEventReceiver(er health.EventReceiver) *dbr.Session {
 	return c.conn.NewSession(er)
 }
 
+func (c *Conn) Stats() sql.DBStats {
+	return c.conn.Stats()
+}
+
 func (c *Conn) SetMaxOpenConns(n int) {
 	c.conn.SetMaxOpenConns(n)
 }
@@ -70,14 +124,17 @@ func (c *Conn) SetConnMaxLifetime(d time.Duration) {
 	c.conn.SetConnMaxLifetime(d)
 }
 
-func newDBRConnection(stream *health.Stream, conf cfg.DB, ro bool) (*dbr.Connection, error) {
+func newDBRConnection(stream *health.Stream, conf cfg.DB, d Dialect, ro bool) (*dbr.Connection, error) {
 	var (
 		err error
 
-		driver                 = conf.Driver
-		dbrDialect dbr.Dialect = dialect.PostgreSQL
+		driver = conf.Driver
 	)
 
+	if err = validateTimeouts(conf); err != nil {
+		return nil, err
+	}
+
 	dsn := conf.DSN
 	if ro {
 		dsn = conf.RODSN
@@ -91,11 +148,21 @@ func newDBRConnection(stream *health.Stream, conf cfg.DB, ro bool) (*dbr.Connect
 
 	// If we're using MySQL we need to ensure to set the parseTime option
 	if conf.Driver == DriverMysql {
-		dbrDialect = dialect.MySQL
 		dsn, err = forceParseTimeParam(dsn)
 		if err != nil {
 			return nil, err
 		}
+		dsn, err = setTimeoutParams(dsn, conf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Driver == DriverPostgres {
+		dsn, err = setPGTimeoutParams(dsn, conf)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Create the underlying connection and ping it to ensure liveness
@@ -104,7 +171,11 @@ func newDBRConnection(stream *health.Stream, conf cfg.DB, ro bool) (*dbr.Connect
 		return nil, err
 	}
 
-	ctx, cancelFn := context.WithTimeout(context.Background(), 1*time.Second)
+	pingTimeout := 1 * time.Second
+	if conf.ConnectTimeout > 0 {
+		pingTimeout = conf.ConnectTimeout
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), pingTimeout)
 	defer cancelFn()
 	if err := rawDBConn.PingContext(ctx); err != nil {
 		return nil, err
@@ -114,6 +185,6 @@ func newDBRConnection(stream *health.Stream, conf cfg.DB, ro bool) (*dbr.Connect
 	return &dbr.Connection{
 		DB:            rawDBConn,
 		EventReceiver: stream,
-		Dialect:       dbrDialect,
+		Dialect:       d.DBR(),
 	}, nil
 }
@@ -1,8 +1,20 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gocraft/dbr/v2"
+	"github.com/gocraft/dbr/v2/dialect"
+	"github.com/gocraft/health"
+	"github.com/lib/pq"
 
 	"github.com/ava-labs/ortelius/cfg"
 )
@@ -24,6 +36,87 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestSetTimeoutParams(t *testing.T) {
+	dsn, err := setTimeoutParams("root:password@tcp(mysql:3306)/ortelius_dev?timeout=30s", cfg.DB{})
+	if err != nil || dsn != "root:password@tcp(mysql:3306)/ortelius_dev?timeout=30s" {
+		t.Fatal("Unexpected dsn", dsn)
+	}
+	dsn, err = setTimeoutParams("root:password@tcp(mysql:3306)/ortelius_dev?timeout=30s", cfg.DB{
+		ConnectTimeout: 2 * time.Second,
+		ReadTimeout:    5 * time.Second,
+		WriteTimeout:   7 * time.Second,
+	})
+	if err != nil || dsn != "root:password@tcp(mysql:3306)/ortelius_dev?readTimeout=5s&timeout=2s&writeTimeout=7s" {
+		t.Fatal("Unexpected dsn", dsn)
+	}
+	dsn, err = setTimeoutParams("root:password@tcp(mysql:3306)/ortelius_dev", cfg.DB{
+		MaxExecutionTime: 1500 * time.Millisecond,
+	})
+	if err != nil || dsn != "root:password@tcp(mysql:3306)/ortelius_dev?max_execution_time=1500" {
+		t.Fatal("Unexpected dsn", dsn)
+	}
+}
+
+func TestSetPGTimeoutParams(t *testing.T) {
+	conf := cfg.DB{
+		ConnectTimeout:   1500 * time.Millisecond,
+		MaxExecutionTime: 3 * time.Second,
+	}
+
+	dsn, err := setPGTimeoutParams("postgres://u:p@pg:5432/ortelius_dev?options=-c+search_path%3Dortelius", conf)
+	if err != nil || dsn != "postgres://u:p@pg:5432/ortelius_dev?connect_timeout=2&options=-c+search_path%3Dortelius+-c+statement_timeout%3D3000" {
+		t.Fatal("Unexpected dsn", dsn, err)
+	}
+
+	dsn, err = setPGTimeoutParams("host=pg dbname=ortelius_dev", conf)
+	if err != nil || dsn != "host='pg' dbname='ortelius_dev' connect_timeout='2' options='-c statement_timeout=3000'" {
+		t.Fatal("Unexpected dsn", dsn, err)
+	}
+
+	dsn, err = setPGTimeoutParams(`host=pg connect_timeout=10 options='-c search_path=it\'s'`, conf)
+	if err != nil || dsn != `host='pg' connect_timeout='2' options='-c search_path=it\'s -c statement_timeout=3000'` {
+		t.Fatal("Unexpected dsn", dsn, err)
+	}
+
+	if _, err = setPGTimeoutParams("host=pg options='-c", conf); err == nil {
+		t.Fatal("Expected unterminated quote to be rejected")
+	}
+
+	dsn, err = setPGTimeoutParams("host=pg", cfg.DB{})
+	if err != nil || dsn != "host=pg" {
+		t.Fatal("Unexpected dsn", dsn, err)
+	}
+
+	if _, err = setPGTimeoutParams("host=pg", cfg.DB{ReadTimeout: time.Second}); err != ErrPGReadWriteTimeout {
+		t.Fatal("Expected read timeout to be rejected", err)
+	}
+	conn, err := New(nil, cfg.DB{Driver: DriverPostgres, DSN: "host=pg", WriteTimeout: time.Second}, false)
+	if conn != nil || err != ErrPGReadWriteTimeout {
+		t.Fatal("Expected New to reject postgres write timeout", err)
+	}
+}
+
+func TestValidateTimeouts(t *testing.T) {
+	if err := validateTimeouts(cfg.DB{ConnectTimeout: 5 * time.Second, ReadTimeout: time.Millisecond}); err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	if err := validateTimeouts(cfg.DB{ConnectTimeout: 30}); err != ErrTimeoutBelowMillisecond {
+		t.Fatal("Expected sub-millisecond connect timeout to be rejected", err)
+	}
+	if err := validateTimeouts(cfg.DB{WriteTimeout: 999 * time.Microsecond}); err != ErrTimeoutBelowMillisecond {
+		t.Fatal("Expected sub-millisecond write timeout to be rejected", err)
+	}
+
+	if err := validateTimeouts(cfg.DB{MaxExecutionTime: 1500}); err != ErrTimeoutBelowMillisecond {
+		t.Fatal("Expected sub-millisecond max execution time to be rejected", err)
+	}
+
+	conn, err := New(nil, cfg.DB{Driver: DriverMysql, DSN: "a:b@tcp(1.2.3.4)/foo", ReadTimeout: 30}, false)
+	if conn != nil || err != ErrTimeoutBelowMillisecond {
+		t.Fatal("Expected New to reject sub-millisecond timeouts", err)
+	}
+}
+
 func TestNewErrors(t *testing.T) {
 	conn, err := New(nil, cfg.DB{
 		Driver: "mysql",
@@ -61,3 +154,223 @@ func TestNewErrors(t *testing.T) {
 		t.Fatal("Expected i/o or context deadline timeout")
 	}
 }
+
+type recordingDriver struct{ execs *[]string }
+
+func (d recordingDriver) Open(string) (driver.Conn, error) { return recordingConn(d), nil }
+
+type recordingConn struct{ execs *[]string }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{execs: c.execs, query: query}, nil
+}
+func (recordingConn) Close() error              { return nil }
+func (recordingConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type recordingStmt struct {
+	execs *[]string
+	query string
+}
+
+func (recordingStmt) Close() error  { return nil }
+func (recordingStmt) NumInput() int { return -1 }
+func (s recordingStmt) Exec([]driver.Value) (driver.Result, error) {
+	*s.execs = append(*s.execs, s.query)
+	return driver.RowsAffected(0), nil
+}
+func (recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestNewSessionCapsTimeout(t *testing.T) {
+	var execs []string
+	sql.Register("db_recording", recordingDriver{execs: &execs})
+	rawDBConn, err := sql.Open("db_recording", "")
+	if err != nil {
+		t.Fatal("open failed", err)
+	}
+	defer rawDBConn.Close()
+
+	conn, err := NewFromSQL(health.NewStream(), rawDBConn, DriverMysql)
+	if err != nil {
+		t.Fatal("conn failed", err)
+	}
+	conn.maxExecutionTime = 5 * time.Second
+	if _, err = conn.NewSession("test", time.Minute); err != nil {
+		t.Fatal("session failed", err)
+	}
+	if _, err = conn.NewSession("test", 2*time.Second); err != nil {
+		t.Fatal("session failed", err)
+	}
+	if len(execs) != 2 ||
+		execs[0] != "SET SESSION MAX_EXECUTION_TIME=5000" ||
+		execs[1] != "SET SESSION MAX_EXECUTION_TIME=2000" {
+		t.Fatal("Unexpected session timeouts", execs)
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	if v := sessionTimeout(time.Minute, 0); v != time.Minute {
+		t.Fatal("Expected an uncapped timeout", v)
+	}
+	if v := sessionTimeout(time.Minute, 5*time.Second); v != 5*time.Second {
+		t.Fatal("Expected the timeout to be capped", v)
+	}
+	if v := sessionTimeout(0, 5*time.Second); v != 5*time.Second {
+		t.Fatal("Expected no limit to be capped", v)
+	}
+	if v := sessionTimeout(time.Second, 5*time.Second); v != time.Second {
+		t.Fatal("Expected a shorter timeout to be kept", v)
+	}
+}
+
+func TestPingClosed(t *testing.T) {
+	rawDBConn, err := sql.Open(DriverMysql, "a:b@tcp(1.2.3.4)/foo")
+	if err != nil {
+		t.Fatal("open failed", err)
+	}
+	if err = rawDBConn.Close(); err != nil {
+		t.Fatal("close failed", err)
+	}
+	conn := &Conn{conn: &dbr.Connection{DB: rawDBConn}}
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFn()
+	if err = conn.Ping(ctx); err == nil {
+		t.Fatal("Expected ping on a closed db to fail")
+	}
+}
+
+func TestIsDeadlock(t *testing.T) {
+	mysqlDeadlock := &mysql.MySQLError{Number: DeadlockDBErrorNumber, Message: DeadlockDBErrorMessage}
+	mysqlDuplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+
+	if IsDeadlock(nil) {
+		t.Fatal("Expected nil to not be a deadlock")
+	}
+	if !IsDeadlock(mysqlDeadlock) {
+		t.Fatal("Expected mysql deadlock")
+	}
+	if !IsDeadlock(fmt.Errorf("commit: %w", mysqlDeadlock)) {
+		t.Fatal("Expected wrapped mysql deadlock")
+	}
+	if IsDeadlock(fmt.Errorf("commit: %w", mysqlDuplicate)) {
+		t.Fatal("Expected wrapped mysql duplicate to not be a deadlock")
+	}
+	if !IsDeadlock(errors.New(DeadlockDBErrorMessage)) {
+		t.Fatal("Expected deadlock message")
+	}
+	if !IsDeadlock(fmt.Errorf("commit: %w", errors.New(DeadlockDBErrorMessage))) {
+		t.Fatal("Expected wrapped deadlock message")
+	}
+	if IsDeadlock(errors.New("other")) {
+		t.Fatal("Expected other error to not be a deadlock")
+	}
+	if !IsDeadlock(fmt.Errorf("commit: %w", &pq.Error{Code: DeadlockPGErrorCode})) {
+		t.Fatal("Expected wrapped postgres deadlock")
+	}
+	if IsDeadlock(&pq.Error{Code: "23505"}) {
+		t.Fatal("Expected postgres unique violation to not be a deadlock")
+	}
+	if !IsDeadlock(errors.New("pq: " + DeadlockPGErrorMessage)) {
+		t.Fatal("Expected postgres deadlock message")
+	}
+}
+
+func TestErrIsDuplicateEntryError(t *testing.T) {
+	if ErrIsDuplicateEntryError(nil) {
+		t.Fatal("Expected nil to not be a duplicate")
+	}
+	if !ErrIsDuplicateEntryError(fmt.Errorf("insert: %w", &mysql.MySQLError{Number: DuplicateEntryDBErrorNumber})) {
+		t.Fatal("Expected wrapped mysql duplicate")
+	}
+	if !ErrIsDuplicateEntryError(errors.New("Error 1062: Duplicate entry 'a' for key 'PRIMARY'")) {
+		t.Fatal("Expected duplicate message")
+	}
+	if !ErrIsDuplicateEntryError(fmt.Errorf("insert: %w", &pq.Error{Code: DuplicateEntryPGErrorCode})) {
+		t.Fatal("Expected wrapped postgres unique violation")
+	}
+	if ErrIsDuplicateEntryError(&pq.Error{Code: DeadlockPGErrorCode}) {
+		t.Fatal("Expected postgres deadlock to not be a duplicate")
+	}
+}
+
+func TestDialect(t *testing.T) {
+	if _, err := NewDialect("sqlite3"); err == nil {
+		t.Fatal("Expected unsupported driver error")
+	}
+
+	mysqlDialect, err := NewDialect(DriverMysql)
+	if err != nil {
+		t.Fatal("mysql dialect failed", err)
+	}
+	if mysqlDialect.DBR() != dialect.MySQL {
+		t.Fatal("Unexpected mysql dbr dialect")
+	}
+	if mysqlDialect.SessionTimeout(2*time.Second) != "SET SESSION MAX_EXECUTION_TIME=2000" {
+		t.Fatal("Unexpected mysql session timeout")
+	}
+	if mysqlDialect.LockForUpdate(100, false) != "LIMIT 100 FOR UPDATE" {
+		t.Fatal("Unexpected mysql lock clause")
+	}
+
+	pgDialect, err := NewDialect(DriverPostgres)
+	if err != nil {
+		t.Fatal("postgres dialect failed", err)
+	}
+	if pgDialect.DBR() != dialect.PostgreSQL {
+		t.Fatal("Unexpected postgres dbr dialect")
+	}
+	if pgDialect.SessionTimeout(2*time.Second) != "SET SESSION statement_timeout=2000" {
+		t.Fatal("Unexpected postgres session timeout")
+	}
+	if pgDialect.LockForUpdate(100, true) != "LIMIT 100 FOR UPDATE SKIP LOCKED" {
+		t.Fatal("Unexpected postgres lock clause")
+	}
+}
+
+func TestRetryOnDeadlock(t *testing.T) {
+	errDeadlock := errors.New("Error 1213: " + DeadlockDBErrorMessage)
+	errOther := errors.New("other")
+
+	attempts := 0
+	err := RetryOnDeadlock(context.Background(), 0, time.Millisecond, func() error {
+		attempts++
+		if attempts < 3 {
+			return errDeadlock
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatal("Expected success after 3 attempts", attempts, err)
+	}
+
+	attempts = 0
+	err = RetryOnDeadlock(context.Background(), 2, time.Millisecond, func() error {
+		attempts++
+		return errDeadlock
+	})
+	if err != errDeadlock || attempts != 2 {
+		t.Fatal("Expected deadlock after 2 attempts", attempts, err)
+	}
+
+	attempts = 0
+	err = RetryOnDeadlock(context.Background(), 0, time.Millisecond, func() error {
+		attempts++
+		return errOther
+	})
+	if err != errOther || attempts != 1 {
+		t.Fatal("Expected no retry on other errors", attempts, err)
+	}
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	attempts = 0
+	err = RetryOnDeadlock(ctx, 0, time.Millisecond, func() error {
+		attempts++
+		cancelFn()
+		return errDeadlock
+	})
+	if err != context.Canceled || attempts != 1 {
+		t.Fatal("Expected context cancellation to stop retries", attempts, err)
+	}
+}
@@ -0,0 +1,70 @@
+// (c) 2020, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocraft/dbr/v2"
+	"github.com/gocraft/dbr/v2/dialect"
+)
+
+// Dialect captures the SQL that differs between the supported drivers
+type Dialect interface {
+	// DBR returns the dbr dialect used to build queries
+	DBR() dbr.Dialect
+
+	// SessionTimeout returns the statement that limits statement execution
+	// time for the current session
+	SessionTimeout(time.Duration) string
+
+	// LockForUpdate returns the clause limiting a select to n rows and locking
+	// them, optionally skipping rows already locked by other transactions.
+	// SKIP LOCKED requires MySQL 8.0 or PostgreSQL 9.5.
+	LockForUpdate(n uint64, skipLocked bool) string
+}
+
+// NewDialect returns the Dialect for the given driver
+func NewDialect(driver string) (Dialect, error) {
+	switch driver {
+	case DriverMysql:
+		return mysqlDialect{}, nil
+	case DriverPostgres:
+		return postgresDialect{}, nil
+	}
+	return nil, fmt.Errorf("unsupported db driver: %s", driver)
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) DBR() dbr.Dialect { return dialect.MySQL }
+
+func (mysqlDialect) SessionTimeout(timeout time.Duration) string {
+	return fmt.Sprintf("SET SESSION MAX_EXECUTION_TIME=%d", timeout.Milliseconds())
+}
+
+func (mysqlDialect) LockForUpdate(n uint64, skipLocked bool) string {
+	return lockForUpdate(n, skipLocked)
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) DBR() dbr.Dialect { return dialect.PostgreSQL }
+
+func (postgresDialect) SessionTimeout(timeout time.Duration) string {
+	return fmt.Sprintf("SET SESSION statement_timeout=%d", timeout.Milliseconds())
+}
+
+func (postgresDialect) LockForUpdate(n uint64, skipLocked bool) string {
+	return lockForUpdate(n, skipLocked)
+}
+
+func lockForUpdate(n uint64, skipLocked bool) string {
+	clause := fmt.Sprintf("LIMIT %d FOR UPDATE", n)
+	if skipLocked {
+		clause += " SKIP LOCKED"
+	}
+	return clause
+}
@@ -4,17 +4,45 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
 
 	"github.com/ava-labs/ortelius/cfg"
 )
 
+var (
+	ErrTimeoutBelowMillisecond = errors.New("db timeouts must be at least 1ms, use a duration string such as \"5s\"")
+	ErrPGReadWriteTimeout      = errors.New("db read and write timeouts are not supported by the postgres driver")
+)
+
 const (
 	RemovedPassword = "[removed]"
 
 	DeadlockDBErrorMessage = "Deadlock found when trying to get lock; try restarting transaction"
+
+	// MySQL ER_LOCK_DEADLOCK
+	DeadlockDBErrorNumber = 1213
+
+	// PostgreSQL deadlock_detected
+	DeadlockPGErrorCode    = "40P01"
+	DeadlockPGErrorMessage = "deadlock detected"
+
+	// MySQL ER_DUP_ENTRY and PostgreSQL unique_violation
+	DuplicateEntryDBErrorNumber = 1062
+	DuplicateEntryPGErrorCode   = "23505"
+
+	// DeadlockRetryDelay is the pause between deadlock retries used by the
+	// consumers and replay
+	DeadlockRetryDelay = 500 * time.Millisecond
 )
 
 func SanitizedDSN(cfg *cfg.DB) (string, string, error) {
@@ -35,8 +63,60 @@ func SanitizedDSN(cfg *cfg.DB) (string, string, error) {
 	return dsn.FormatDSN(), rodsn.FormatDSN(), nil
 }
 
+// ErrIsDuplicateEntryError reports whether err, or any error it wraps, is a
+// MySQL duplicate entry or a PostgreSQL unique violation.
 func ErrIsDuplicateEntryError(err error) bool {
-	return err != nil && strings.HasPrefix(err.Error(), "Error 1062: Duplicate entry")
+	if err == nil {
+		return false
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == DuplicateEntryDBErrorNumber
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == DuplicateEntryPGErrorCode
+	}
+	return strings.HasPrefix(err.Error(), "Error 1062: Duplicate entry")
+}
+
+// IsDeadlock reports whether err, or any error it wraps, is a MySQL or
+// PostgreSQL deadlock.  Errors not from either driver fall back to matching
+// the deadlock messages.
+func IsDeadlock(err error) bool {
+	if err == nil {
+		return false
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == DeadlockDBErrorNumber
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == DeadlockPGErrorCode
+	}
+	msg := err.Error()
+	return strings.Contains(msg, DeadlockDBErrorMessage) || strings.Contains(msg, DeadlockPGErrorMessage)
+}
+
+// RetryOnDeadlock runs fn until it succeeds, returns a non-deadlock error, or
+// maxAttempts is reached, waiting delay between attempts.  maxAttempts <= 0
+// retries until ctx is done.
+func RetryOnDeadlock(ctx context.Context, maxAttempts int, delay time.Duration, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !IsDeadlock(err) || (maxAttempts > 0 && attempt >= maxAttempts) {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
 }
 
 func forceParseTimeParam(dsn string) (string, error) {
@@ -54,3 +134,183 @@ func forceParseTimeParam(dsn string) (string, error) {
 	// Re-encode as a string
 	return u.FormatDSN(), nil
 }
+
+// validateTimeouts rejects configured timeouts under 1ms, which come from
+// bare numbers being read as nanoseconds
+func validateTimeouts(conf cfg.DB) error {
+	for _, timeout := range []time.Duration{conf.ConnectTimeout, conf.ReadTimeout, conf.WriteTimeout, conf.MaxExecutionTime} {
+		if timeout > 0 && timeout < time.Millisecond {
+			return ErrTimeoutBelowMillisecond
+		}
+	}
+	return nil
+}
+
+// setTimeoutParams applies the configured connect/read/write timeouts and the
+// max_execution_time session variable to the dsn.  Timeouts that are not
+// configured leave the dsn's own values in place.
+func setTimeoutParams(dsn string, conf cfg.DB) (string, error) {
+	u, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+
+	if conf.ConnectTimeout > 0 {
+		u.Timeout = conf.ConnectTimeout
+	}
+	if conf.ReadTimeout > 0 {
+		u.ReadTimeout = conf.ReadTimeout
+	}
+	if conf.WriteTimeout > 0 {
+		u.WriteTimeout = conf.WriteTimeout
+	}
+	if conf.MaxExecutionTime > 0 {
+		if u.Params == nil {
+			u.Params = make(map[string]string)
+		}
+		u.Params["max_execution_time"] = strconv.FormatInt(conf.MaxExecutionTime.Milliseconds(), 10)
+	}
+
+	return u.FormatDSN(), nil
+}
+
+// setPGTimeoutParams applies the configured connect timeout and max execution
+// time to a postgres dsn, in either URL or key=value form.  The statement
+// timeout is appended to any options already in the dsn.  The connect
+// timeout is rounded up to whole seconds as lib/pq requires.  lib/pq has no
+// read or write timeouts, so configuring them is an error.
+func setPGTimeoutParams(dsn string, conf cfg.DB) (string, error) {
+	if conf.ReadTimeout > 0 || conf.WriteTimeout > 0 {
+		return "", ErrPGReadWriteTimeout
+	}
+
+	params := make(map[string]string)
+	if conf.ConnectTimeout > 0 {
+		seconds := (conf.ConnectTimeout + time.Second - 1) / time.Second
+		params["connect_timeout"] = strconv.FormatInt(int64(seconds), 10)
+	}
+	if conf.MaxExecutionTime > 0 {
+		params["options"] = fmt.Sprintf("-c statement_timeout=%d", conf.MaxExecutionTime.Milliseconds())
+	}
+	if len(params) == 0 {
+		return dsn, nil
+	}
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		for k, v := range params {
+			if k == "options" && q.Get(k) != "" {
+				v = q.Get(k) + " " + v
+			}
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+
+	pairs, err := parsePGConnInfo(dsn)
+	if err != nil {
+		return "", err
+	}
+	for _, k := range []string{"connect_timeout", "options"} {
+		v, ok := params[k]
+		if !ok {
+			continue
+		}
+		if k == "options" && pairs.get(k) != "" {
+			v = pairs.get(k) + " " + v
+		}
+		pairs = pairs.set(k, v)
+	}
+	return pairs.String(), nil
+}
+
+// pgConnInfo is a key=value postgres dsn, keeping the order of its keys
+type pgConnInfo [][2]string
+
+// parsePGConnInfo splits a key=value postgres dsn the way lib/pq does: values
+// may be single quoted and backslash escapes the next character.
+func parsePGConnInfo(dsn string) (pgConnInfo, error) {
+	var pairs pgConnInfo
+	r := []rune(dsn)
+	i := 0
+	skipSpace := func() {
+		for i < len(r) && unicode.IsSpace(r[i]) {
+			i++
+		}
+	}
+	for {
+		skipSpace()
+		if i >= len(r) {
+			return pairs, nil
+		}
+
+		start := i
+		for i < len(r) && r[i] != '=' && !unicode.IsSpace(r[i]) {
+			i++
+		}
+		key := string(r[start:i])
+		skipSpace()
+		if i >= len(r) || r[i] != '=' {
+			return nil, fmt.Errorf("missing \"=\" after %q in postgres dsn", key)
+		}
+		i++
+		skipSpace()
+
+		var value []rune
+		quoted := i < len(r) && r[i] == '\''
+		if quoted {
+			i++
+		}
+		for ; i < len(r); i++ {
+			if r[i] == '\\' && i+1 < len(r) {
+				i++
+				value = append(value, r[i])
+				continue
+			}
+			if (quoted && r[i] == '\'') || (!quoted && unicode.IsSpace(r[i])) {
+				break
+			}
+			value = append(value, r[i])
+		}
+		if quoted {
+			if i >= len(r) {
+				return nil, fmt.Errorf("unterminated quoted value for %q in postgres dsn", key)
+			}
+			i++
+		}
+		pairs = pairs.set(key, string(value))
+	}
+}
+
+func (p pgConnInfo) get(key string) string {
+	for _, pair := range p {
+		if pair[0] == key {
+			return pair[1]
+		}
+	}
+	return ""
+}
+
+func (p pgConnInfo) set(key string, value string) pgConnInfo {
+	for i, pair := range p {
+		if pair[0] == key {
+			p[i][1] = value
+			return p
+		}
+	}
+	return append(p, [2]string{key, value})
+}
+
+func (p pgConnInfo) String() string {
+	escaper := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	parts := make([]string, 0, len(p))
+	for _, pair := range p {
+		parts = append(parts, pair[0]+"='"+escaper.Replace(pair[1])+"'")
+	}
+	return strings.Join(parts, " ")
+}
@@ -2,12 +2,12 @@ package metrics
 
 import (
 	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promauto"
-
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
@@ -21,6 +21,7 @@ func init() {
 type Metrics struct {
 	counters    map[string]*prometheus.Counter
 	histograms  map[string]*prometheus.Histogram
+	gauges      map[string]*prometheus.Gauge
 	metricsLock sync.RWMutex
 }
 
@@ -33,65 +34,220 @@ func (m *Metrics) Init() {
 	if m.histograms == nil {
 		m.histograms = make(map[string]*prometheus.Histogram)
 	}
+	if m.gauges == nil {
+		m.gauges = make(map[string]*prometheus.Gauge)
+	}
 }
 
+// DefaultMillisBuckets are the buckets of histograms registered on first use
+var DefaultMillisBuckets = []float64{1, 5, 10, 50, 100, 500, 1000, 5000, 10000}
+
+const (
+	kindCounter   = "counter"
+	kindHistogram = "histogram"
+	kindGauge     = "gauge"
+)
+
+type registeredMetric struct {
+	kind      string
+	collector prometheus.Collector
+}
+
+// registry holds every metric registered by any Metrics instance, by name, so
+// repeated or out of order inits share one collector
+var (
+	registry     = make(map[string]registeredMetric)
+	registryLock sync.Mutex
+)
+
+// CounterInit registers the named counter.  If it is already registered, by
+// this or another Metrics, the existing counter and its help text are kept.
 func (m *Metrics) CounterInit(name string, help string) {
+	_, _ = m.counterInit(name, help)
+}
+
+func (m *Metrics) CounterInc(name string) error {
+	counter, err := m.counter(name)
+	if err != nil {
+		return err
+	}
+	counter.Inc()
+	return nil
+}
+
+func (m *Metrics) CounterAdd(name string, v float64) error {
+	counter, err := m.counter(name)
+	if err != nil {
+		return err
+	}
+	counter.Add(v)
+	return nil
+}
+
+// HistogramInit registers the named histogram.  If it is already registered
+// the existing histogram, help text and buckets are kept.
+func (m *Metrics) HistogramInit(name string, help string, buckets []float64) {
+	_, _ = m.histogramInit(name, help, buckets)
+}
+
+func (m *Metrics) HistogramObserve(name string, v float64) error {
+	histogram, err := m.histogram(name)
+	if err != nil {
+		return err
+	}
+	histogram.Observe(v)
+	return nil
+}
+
+// GaugeInit registers the named gauge.  If it is already registered the
+// existing gauge and its help text are kept.
+func (m *Metrics) GaugeInit(name string, help string) {
+	_, _ = m.gaugeInit(name, help)
+}
+
+func (m *Metrics) GaugeSet(name string, v float64) error {
+	gauge, err := m.gauge(name)
+	if err != nil {
+		return err
+	}
+	gauge.Set(v)
+	return nil
+}
+
+func (m *Metrics) GaugeAdd(name string, v float64) error {
+	gauge, err := m.gauge(name)
+	if err != nil {
+		return err
+	}
+	gauge.Add(v)
+	return nil
+}
+
+// counter returns the named counter, registering it on first use when it
+// was not initialized with help text.
+func (m *Metrics) counter(name string) (prometheus.Counter, error) {
+	m.metricsLock.RLock()
+	counter, ok := m.counters[name]
+	m.metricsLock.RUnlock()
+	if ok {
+		return *counter, nil
+	}
+	return m.counterInit(name, name)
+}
+
+func (m *Metrics) counterInit(name string, help string) (prometheus.Counter, error) {
 	m.Init()
 	m.metricsLock.Lock()
 	defer m.metricsLock.Unlock()
-	if _, ok := m.counters[name]; ok {
-		return
+	if counter, ok := m.counters[name]; ok {
+		return *counter, nil
 	}
-	counter := promauto.NewCounter(prometheus.CounterOpts{
-		Name: name,
-		Help: help,
+	c, err := register(name, kindCounter, func() prometheus.Collector {
+		return prometheus.NewCounter(prometheus.CounterOpts{
+			Name: name,
+			Help: help,
+		})
 	})
+	if err != nil {
+		return nil, err
+	}
+	counter := c.(prometheus.Counter)
 	m.counters[name] = &counter
+	return counter, nil
 }
 
-func (m *Metrics) CounterInc(name string) error {
+// histogram returns the named histogram, registering it with
+// DefaultMillisBuckets on first use when it was not initialized.
+func (m *Metrics) histogram(name string) (prometheus.Histogram, error) {
 	m.metricsLock.RLock()
-	defer m.metricsLock.RUnlock()
-	if counter, ok := m.counters[name]; ok {
-		(*counter).Inc()
-		return nil
+	histogram, ok := m.histograms[name]
+	m.metricsLock.RUnlock()
+	if ok {
+		return *histogram, nil
 	}
-	return fmt.Errorf("metric not found: %s", name)
+	return m.histogramInit(name, name, DefaultMillisBuckets)
 }
 
-func (m *Metrics) CounterAdd(name string, v float64) error {
+func (m *Metrics) histogramInit(name string, help string, buckets []float64) (prometheus.Histogram, error) {
+	m.Init()
+	m.metricsLock.Lock()
+	defer m.metricsLock.Unlock()
+	if histogram, ok := m.histograms[name]; ok {
+		return *histogram, nil
+	}
+	c, err := register(name, kindHistogram, func() prometheus.Collector {
+		return prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    name,
+			Help:    help,
+			Buckets: buckets,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	histogram := c.(prometheus.Histogram)
+	m.histograms[name] = &histogram
+	return histogram, nil
+}
+
+// gauge returns the named gauge, registering it on first use when it was not
+// initialized with help text.
+func (m *Metrics) gauge(name string) (prometheus.Gauge, error) {
 	m.metricsLock.RLock()
-	defer m.metricsLock.RUnlock()
-	if counter, ok := m.counters[name]; ok {
-		(*counter).Add(v)
-		return nil
+	gauge, ok := m.gauges[name]
+	m.metricsLock.RUnlock()
+	if ok {
+		return *gauge, nil
 	}
-	return fmt.Errorf("metric not found: %s", name)
+	return m.gaugeInit(name, name)
 }
 
-func (m *Metrics) HistogramInit(name string, help string, buckets []float64) {
+func (m *Metrics) gaugeInit(name string, help string) (prometheus.Gauge, error) {
 	m.Init()
 	m.metricsLock.Lock()
 	defer m.metricsLock.Unlock()
-	if _, ok := m.histograms[name]; ok {
-		return
+	if gauge, ok := m.gauges[name]; ok {
+		return *gauge, nil
 	}
-	histogram := promauto.NewHistogram(prometheus.HistogramOpts{
-		Name:    name,
-		Help:    help,
-		Buckets: buckets,
+	c, err := register(name, kindGauge, func() prometheus.Collector {
+		return prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: name,
+			Help: help,
+		})
 	})
-	m.histograms[name] = &histogram
+	if err != nil {
+		return nil, err
+	}
+	gauge := c.(prometheus.Gauge)
+	m.gauges[name] = &gauge
+	return gauge, nil
+}
+
+// register returns the collector already registered under name, or registers
+// the one built by newCollector with the default registry.  Metrics are keyed
+// on name alone, so inits with different help text share the first collector.
+// Using a name registered as another kind of metric is an error.
+func register(name string, kind string, newCollector func() prometheus.Collector) (prometheus.Collector, error) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if existing, ok := registry[name]; ok {
+		if existing.kind != kind {
+			return nil, fmt.Errorf("metric %s is registered as a %s, not a %s", name, existing.kind, kind)
+		}
+		return existing.collector, nil
+	}
+	c := newCollector()
+	if err := prometheus.Register(c); err != nil {
+		return nil, err
+	}
+	registry[name] = registeredMetric{kind: kind, collector: c}
+	return c, nil
 }
 
-func (m *Metrics) HistogramObserve(name string, v float64) error {
-	m.metricsLock.RLock()
-	defer m.metricsLock.RUnlock()
-	if histogram, ok := m.histograms[name]; ok {
-		(*histogram).Observe(v)
-		return nil
-	}
-	return fmt.Errorf("metric not found: %s", name)
+// OpenMetricsHandler serves the default registry, rendering the OpenMetrics
+// text format (with help/type metadata) when the scraper negotiates it.
+func OpenMetricsHandler() http.Handler {
+	return promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})
 }
 
 type Collector interface {
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCounterInitIdempotent(t *testing.T) {
+	var m1, m2 Metrics
+	m1.CounterInit("test_counter_init_idempotent", "test counter")
+	m1.CounterInit("test_counter_init_idempotent", "test counter")
+	m2.CounterInit("test_counter_init_idempotent", "test counter")
+
+	if err := m1.CounterAdd("test_counter_init_idempotent", 2); err != nil {
+		t.Fatal("counter add failed", err)
+	}
+	if *m1.counters["test_counter_init_idempotent"] != *m2.counters["test_counter_init_idempotent"] {
+		t.Fatal("expected the registered counter to be shared")
+	}
+}
+
+func TestHistogramInitIdempotent(t *testing.T) {
+	var m1, m2 Metrics
+	m1.HistogramInit("test_histogram_init_idempotent", "test histogram", []float64{1, 10})
+	m2.HistogramInit("test_histogram_init_idempotent", "test histogram", []float64{1, 10})
+
+	if err := m2.HistogramObserve("test_histogram_init_idempotent", 5); err != nil {
+		t.Fatal("histogram observe failed", err)
+	}
+	if *m1.histograms["test_histogram_init_idempotent"] != *m2.histograms["test_histogram_init_idempotent"] {
+		t.Fatal("expected the registered histogram to be shared")
+	}
+}
+
+func TestRegisterOnFirstUse(t *testing.T) {
+	var m Metrics
+	if err := m.CounterAdd("test_lazy_counter", 2); err != nil {
+		t.Fatal("counter add failed", err)
+	}
+	if err := m.HistogramObserve("test_lazy_histogram", 5); err != nil {
+		t.Fatal("histogram observe failed", err)
+	}
+	if err := m.GaugeSet("test_lazy_gauge", 3); err != nil {
+		t.Fatal("gauge set failed", err)
+	}
+	if err := m.GaugeAdd("test_lazy_gauge", -1); err != nil {
+		t.Fatal("gauge add failed", err)
+	}
+
+	if v := testutil.ToFloat64(*m.counters["test_lazy_counter"]); v != 2 {
+		t.Fatal("unexpected counter value", v)
+	}
+	if v := testutil.ToFloat64(*m.gauges["test_lazy_gauge"]); v != 2 {
+		t.Fatal("unexpected gauge value", v)
+	}
+
+	// A later init keeps the collector registered on first use
+	m.CounterInit("test_lazy_counter", "test lazy counter")
+	if v := testutil.ToFloat64(*m.counters["test_lazy_counter"]); v != 2 {
+		t.Fatal("unexpected counter value after init", v)
+	}
+}
+
+func TestOpenMetricsHandler(t *testing.T) {
+	var m Metrics
+	m.CounterInit("test_openmetrics_requests_total", "test openmetrics counter")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	rec := httptest.NewRecorder()
+	OpenMetricsHandler().ServeHTTP(rec, req)
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/openmetrics-text") {
+		t.Fatal("unexpected content type", rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "# TYPE test_openmetrics_requests counter") ||
+		!strings.Contains(body, "# HELP test_openmetrics_requests test openmetrics counter") {
+		t.Fatal("missing openmetrics metadata", body)
+	}
+}
+
+func TestInitAfterFirstUseInOtherMetrics(t *testing.T) {
+	var m1, m2 Metrics
+	if err := m1.CounterInc("test_lazy_then_init_counter"); err != nil {
+		t.Fatal("counter inc failed", err)
+	}
+	m2.CounterInit("test_lazy_then_init_counter", "test counter with different help")
+	if err := m2.CounterInc("test_lazy_then_init_counter"); err != nil {
+		t.Fatal("counter inc failed", err)
+	}
+	if v := testutil.ToFloat64(*m1.counters["test_lazy_then_init_counter"]); v != 2 {
+		t.Fatal("expected the counter to be shared", v)
+	}
+}
+
+func TestMetricKindMismatch(t *testing.T) {
+	var m Metrics
+	m.CounterInit("test_kind_mismatch", "test counter")
+	if err := m.GaugeSet("test_kind_mismatch", 1); err == nil {
+		t.Fatal("expected a gauge on a counter name to fail")
+	}
+	if err := m.HistogramObserve("test_kind_mismatch", 1); err == nil {
+		t.Fatal("expected a histogram on a counter name to fail")
+	}
+
+	m.GaugeInit("test_kind_mismatch_gauge", "test gauge")
+	if err := m.CounterInc("test_kind_mismatch_gauge"); err == nil {
+		t.Fatal("expected a counter on a gauge name to fail")
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"time"
 
 	"github.com/ava-labs/ortelius/services/metrics"
@@ -18,6 +19,21 @@ const (
 	MetricConsumeProcessMillisCounterKey = "consume_records_process_millis"
 	MetricConsumeSuccessCountKey         = "consume_records_success"
 	MetricConsumeFailureCountKey         = "consume_records_failure"
+
+	MetricPoolOpenConnectionsKey    = "pool_open_connections"
+	MetricPoolInUseKey              = "pool_in_use"
+	MetricPoolIdleKey               = "pool_idle"
+	MetricPoolWaitCountKey          = "pool_wait_count"
+	MetricPoolWaitDurationMillisKey = "pool_wait_duration_millis"
+
+	poolMetricsNameDB   = "db"
+	poolMetricsNameDBRO = "db_ro"
+)
+
+const (
+	DefaultMaxIdleConns    = 32
+	DefaultConnMaxIdleTime = 5 * time.Minute
+	DefaultConnMaxLifetime = 5 * time.Minute
 )
 
 type Control struct {
@@ -43,14 +59,94 @@ func (s *Control) InitConsumeMetrics() {
 	metrics.Prometheus.CounterInit(MetricConsumeFailureCountKey, "records failure")
 }
 
+// StartPoolMetrics periodically adds the pool stats of conns to metrics
+// prefixed with name, until ctx is done.  Stats are published as deltas so
+// every open pool with the same name sums into one set of metrics.
+func (s *Control) StartPoolMetrics(ctx context.Context, name string, conns *Connections) {
+	if s.poolMetricsInterval() <= 0 {
+		return
+	}
+	go s.runPoolMetrics(ctx, name, conns)
+}
+
+func (s *Control) runPoolMetrics(ctx context.Context, name string, conns *Connections) {
+	gaugeKeys := []string{
+		name + "_" + MetricPoolOpenConnectionsKey,
+		name + "_" + MetricPoolInUseKey,
+		name + "_" + MetricPoolIdleKey,
+	}
+	counterKeys := []string{
+		name + "_" + MetricPoolWaitCountKey,
+		name + "_" + MetricPoolWaitDurationMillisKey,
+	}
+	metrics.Prometheus.GaugeInit(gaugeKeys[0], "db pool open connections")
+	metrics.Prometheus.GaugeInit(gaugeKeys[1], "db pool in use connections")
+	metrics.Prometheus.GaugeInit(gaugeKeys[2], "db pool idle connections")
+	metrics.Prometheus.CounterInit(counterKeys[0], "db pool total connections waited for")
+	metrics.Prometheus.CounterInit(counterKeys[1], "db pool total time blocked waiting millis")
+
+	lastGauges := make([]float64, len(gaugeKeys))
+	publishGauges := func(values []float64) {
+		for i, key := range gaugeKeys {
+			if err := metrics.Prometheus.GaugeAdd(key, values[i]-lastGauges[i]); err != nil {
+				s.Log.Warn("pool metrics %s: %v", key, err)
+			}
+		}
+		lastGauges = values
+	}
+	// Remove this pool's share from the gauges when it stops reporting.  The
+	// wait counters keep their totals.
+	defer publishGauges(make([]float64, len(gaugeKeys)))
+
+	lastCounters := make([]float64, len(counterKeys))
+	publishCounters := func(values []float64) {
+		for i, key := range counterKeys {
+			if values[i] > lastCounters[i] {
+				if err := metrics.Prometheus.CounterAdd(key, values[i]-lastCounters[i]); err != nil {
+					s.Log.Warn("pool metrics %s: %v", key, err)
+				}
+			}
+		}
+		lastCounters = values
+	}
+
+	ticker := time.NewTicker(s.poolMetricsInterval())
+	defer ticker.Stop()
+	for {
+		stats := conns.DB().Stats()
+		publishGauges([]float64{
+			float64(stats.OpenConnections),
+			float64(stats.InUse),
+			float64(stats.Idle),
+		})
+		publishCounters([]float64{
+			float64(stats.WaitCount),
+			float64(stats.WaitDuration.Milliseconds()),
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Control) HealthCheck(ctx context.Context, conns *Connections) error {
+	if err := conns.HealthCheck(ctx); err != nil {
+		s.Log.Warn("health check failed %v", err)
+		return err
+	}
+	return nil
+}
+
 func (s *Control) Database() (*Connections, error) {
 	c, err := NewConnectionsFromConfig(s.Services, false)
 	if err != nil {
 		return nil, err
 	}
-	c.DB().SetMaxIdleConns(32)
-	c.DB().SetConnMaxIdleTime(5 * time.Minute)
-	c.DB().SetConnMaxLifetime(5 * time.Minute)
+	configurePool(c, s.dbConfig().Pool)
+	s.startConnectionsPoolMetrics(poolMetricsNameDB, c)
 	return c, err
 }
 
@@ -59,8 +155,47 @@ func (s *Control) DatabaseRO() (*Connections, error) {
 	if err != nil {
 		return nil, err
 	}
-	c.DB().SetMaxIdleConns(32)
-	c.DB().SetConnMaxIdleTime(5 * time.Minute)
-	c.DB().SetConnMaxLifetime(5 * time.Minute)
+	configurePool(c, s.dbConfig().ROPool)
+	s.startConnectionsPoolMetrics(poolMetricsNameDBRO, c)
 	return c, err
 }
+
+// startConnectionsPoolMetrics publishes pool stats for c until it is closed
+func (s *Control) startConnectionsPoolMetrics(name string, c *Connections) {
+	if s.poolMetricsInterval() <= 0 {
+		return
+	}
+	ctx, cancelFn := context.WithCancel(context.Background())
+	c.stopPoolMetrics = cancelFn
+	s.StartPoolMetrics(ctx, name, c)
+}
+
+// dbConfig returns the configured db settings, or the zero value when no db
+// is configured
+func (s *Control) dbConfig() cfg.DB {
+	if s.Services.DB == nil {
+		return cfg.DB{}
+	}
+	return *s.Services.DB
+}
+
+// poolMetricsInterval is how often pool stats are published.  Zero or a
+// negative interval disables pool metrics.
+func (s *Control) poolMetricsInterval() time.Duration {
+	return s.dbConfig().PoolMetricsInterval
+}
+
+func configurePool(c *Connections, pool cfg.DBPool) {
+	if pool.MaxIdleConns == 0 {
+		pool.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if pool.ConnMaxIdleTime == 0 {
+		pool.ConnMaxIdleTime = DefaultConnMaxIdleTime
+	}
+	if pool.ConnMaxLifetime == 0 {
+		pool.ConnMaxLifetime = DefaultConnMaxLifetime
+	}
+	c.DB().SetMaxIdleConns(pool.MaxIdleConns)
+	c.DB().SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	c.DB().SetConnMaxLifetime(pool.ConnMaxLifetime)
+}
@@ -6,7 +6,6 @@ package stream
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/ava-labs/ortelius/services/db"
@@ -162,13 +161,9 @@ func (c *consumer) ProcessNextMessage() error {
 		}
 	}()
 
-	for {
-		err = c.persistConsume(msg)
-		if err == nil || !strings.Contains(err.Error(), db.DeadlockDBErrorMessage) {
-			break
-		}
-		time.Sleep(500 * time.Millisecond)
-	}
+	err = db.RetryOnDeadlock(context.Background(), 0, db.DeadlockRetryDelay, func() error {
+		return c.persistConsume(msg)
+	})
 	if err != nil {
 		collectors.Error()
 		c.sc.Log.Error("consumer.Consume: %s", err)
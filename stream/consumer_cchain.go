@@ -7,7 +7,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"strings"
 	"sync"
 	"time"
 
@@ -144,13 +143,9 @@ func (c *ConsumerCChain) Consume(msg services.Consumable, persist services.Persi
 	id := hashing.ComputeHash256(block.BlockExtraData)
 	nmsg := NewMessage(string(id), msg.ChainID(), block.BlockExtraData, msg.Timestamp())
 
-	for {
-		err = c.persistConsume(nmsg, block)
-		if err == nil || !strings.Contains(err.Error(), db.DeadlockDBErrorMessage) {
-			break
-		}
-		time.Sleep(500 * time.Millisecond)
-	}
+	err = db.RetryOnDeadlock(context.Background(), 0, db.DeadlockRetryDelay, func() error {
+		return c.persistConsume(nmsg, block)
+	})
 	if err != nil {
 		collectors.Error()
 		c.sc.Log.Error("consumer.Consume: %s", err)